@@ -0,0 +1,90 @@
+// Command spluggy scans a set of sibling Go packages for a common plugin
+// shape (either a single exported function or an interface's methods) and
+// generates the glue code a host program needs to load them as plugins.
+// See pkg/spluggy for the underlying Scan/Render API.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gtrevg/spluggy/pkg/spluggy"
+)
+
+var argfuncname = flag.String("func", "", "The interface function name")
+var argbasepkg = flag.String("pkg", "", "Optional import-path filter: only packages at or under this path are treated as plugins")
+var argoutfname = flag.String("out", "plugins.go", "Output file name")
+var argverbose = flag.Bool("v", false, "Flag to enable verbose output")
+var argiface = flag.String("iface", "", "Interface name to bind in -iface mode, looked up in base or synthesized from -methods")
+var argmethods = flag.String("methods", "", "Comma-separated method names, used when -iface names an interface that doesn't exist yet")
+var argmode = flag.String("mode", "static", "Output mode: static imports every package directly, dynamic loads .so plugins at runtime")
+
+func main() {
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) != 1 {
+		flag.Usage()
+		log.Fatalf("Wrong number of arguments. You need to specify a directory")
+	}
+
+	base := args[0]
+	if strings.HasPrefix(base, "./") {
+		base = base[2:]
+	}
+
+	plan, err := spluggy.Scan(spluggy.Config{
+		Dir:       base,
+		FuncName:  *argfuncname,
+		BasePkg:   *argbasepkg,
+		OutFile:   *argoutfname,
+		Interface: *argiface,
+		Methods:   *argmethods,
+		Mode:      spluggy.Mode(*argmode),
+		Verbose:   *argverbose,
+	})
+	if err != nil {
+		flag.Usage()
+		log.Fatalf("%+v", err)
+	}
+
+	if makefile, ok := plan.Makefile(); ok {
+		mfout := filepath.Join(base, "Makefile.plugins")
+		if err := os.WriteFile(mfout, makefile, 0644); err != nil {
+			log.Fatalf("Failed to write %s: %+v", mfout, err)
+		}
+		log_Debug("Makefile written to %s\n", mfout)
+	}
+
+	for rel, content := range plan.PluginMains() {
+		mainout := filepath.Join(base, rel)
+		if err := os.MkdirAll(filepath.Dir(mainout), 0755); err != nil {
+			log.Fatalf("Failed to create %s: %+v", filepath.Dir(mainout), err)
+		}
+		if err := os.WriteFile(mainout, []byte(content), 0644); err != nil {
+			log.Fatalf("Failed to write %s: %+v", mainout, err)
+		}
+		log_Debug("Plugin main written to %s\n", mainout)
+	}
+
+	out := filepath.Join(base, plan.OutFile())
+	f, err := os.Create(out)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %+v", out, err)
+	}
+	defer f.Close()
+	if err := plan.Render(f); err != nil {
+		log.Fatalf("Failed to write code to %s: %+v", out, err)
+	}
+	log_Debug("Plugins definition written to %s\n", out)
+}
+
+func log_Debug(fmtstr string, vars ...interface{}) {
+	if !*argverbose {
+		return
+	}
+	log.Printf("[DEBUG] "+fmtstr, vars...)
+}
@@ -0,0 +1,951 @@
+// Package spluggy discovers a common plugin shape across a set of Go
+// packages and generates the glue code (and, in -mode=dynamic, build rules)
+// that lets a host program load them as plugins. It is the engine behind
+// the spluggy command; see cmd/spluggy for the CLI wrapper.
+package spluggy
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"io"
+	"log"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// Mode selects how Plugins() resolves its plugins in generated code.
+type Mode string
+
+const (
+	// ModeStatic imports every scanned package directly.
+	ModeStatic Mode = "static"
+	// ModeDynamic discovers and loads .so files at runtime via Go's plugin
+	// package, and comes with a companion Makefile to build them.
+	ModeDynamic Mode = "dynamic"
+)
+
+// Config describes one scan: which directory to load packages from, which
+// plugin shape to look for, and how to render it.
+type Config struct {
+	// Dir is the directory to load packages from (the root package, plus
+	// every package under it).
+	Dir string
+	// FuncName picks the candidate function by name when more than one
+	// exported function is common to every plugin package. Ignored in
+	// interface mode.
+	FuncName string
+	// BasePkg optionally filters plugin packages to those whose import
+	// path is at or under it; packages outside BasePkg are still eligible
+	// to be the root package.
+	BasePkg string
+	// OutFile is the generated file's name, resolved relative to Dir by
+	// the caller. Defaults to "plugins.go".
+	OutFile string
+	// Interface, when set, switches to interface mode: every plugin
+	// package must supply all of the named interface's methods. The
+	// interface is looked up in the root package unless Methods is set.
+	Interface string
+	// Methods synthesizes Interface from a comma-separated method list,
+	// for when it isn't declared anywhere in Dir.
+	Methods string
+	// Mode selects static or dynamic generation. Defaults to ModeStatic.
+	Mode Mode
+	// Verbose enables debug logging via the standard log package.
+	Verbose bool
+}
+
+// Plan is the result of a scan: the generated file's content and,
+// in ModeDynamic, the companion Makefile's content plus one main-package
+// wrapper source per plugin package (see PluginMains).
+type Plan struct {
+	cfg         Config
+	code        []string
+	makefile    []string
+	pluginMains map[string]string
+}
+
+// OutFile is cfg.OutFile with defaulting applied, for callers that want to
+// know what Render's content should be written to.
+func (p *Plan) OutFile() string { return p.cfg.OutFile }
+
+// Makefile returns the companion Makefile's content and true when the scan
+// was done in ModeDynamic; it returns false otherwise.
+func (p *Plan) Makefile() ([]byte, bool) {
+	if p.makefile == nil {
+		return nil, false
+	}
+	return []byte(strings.Join(p.makefile, "\n")), true
+}
+
+// PluginMains returns, in ModeDynamic only, the wrapper source each
+// Makefile target builds, keyed by its path relative to Config.Dir. Go's
+// plugin package only builds main packages into .so files ("-buildmode=
+// plugin requires exactly one main package"), but the plugin packages
+// themselves are ordinary importable packages, shared with ModeStatic's
+// direct imports. Each wrapper is a minimal main package that imports its
+// plugin package and re-exports the chosen symbol under the same name, so
+// Makefile.plugins builds the wrapper rather than the plugin package
+// directly. Returns nil outside ModeDynamic.
+func (p *Plan) PluginMains() map[string]string { return p.pluginMains }
+
+// Render writes the generated file's content to w.
+func (p *Plan) Render(w io.Writer) error {
+	_, err := io.WriteString(w, strings.Join(p.code, "\n"))
+	return err
+}
+
+// Scan loads the packages described by cfg and resolves them into a Plan,
+// the way the spluggy command's main used to do inline: discovering the
+// common plugin shape (one function, or an interface's methods), checking
+// that every package agrees on its signature(s), and rendering the chosen
+// Mode's generated code.
+func Scan(cfg Config) (*Plan, error) {
+	if cfg.OutFile == "" {
+		cfg.OutFile = "plugins.go"
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeStatic
+	}
+
+	root, pluginPkgs, err := load_packages(cfg.Dir, cfg.BasePkg)
+	if err != nil {
+		return nil, err
+	}
+	if len(pluginPkgs) == 0 {
+		return nil, fmt.Errorf("no plugin packages found under %s", cfg.Dir)
+	}
+
+	if len(cfg.Interface) > 0 {
+		return scan_iface(cfg, root, pluginPkgs)
+	}
+	return scan_func(cfg, pluginPkgs)
+}
+
+// scan_func implements the default mode: find the one exported function
+// common to every plugin package and render it as cfg.Mode directs.
+func scan_func(cfg Config, pluginPkgs []*packages.Package) (*Plan, error) {
+	pkgfuncs := make(map[string][]ExportedFunction, len(pluginPkgs))
+	for _, p := range pluginPkgs {
+		log_Debug(cfg.Verbose, "About to process package %s\n", p.PkgPath)
+		funcs := package_functions(p, cfg.Verbose)
+		log_Debug(cfg.Verbose, "resulted functions: %+v\n", funcs)
+		pkgfuncs[p.PkgPath] = funcs
+	}
+
+	log_Debug(cfg.Verbose, "pkgfuncs: %+v\n", pkgfuncs)
+
+	funcocc := make(map[string]int)
+	for _, fns := range pkgfuncs {
+		for _, fn := range fns {
+			if len(cfg.FuncName) > 0 && fn.Name != cfg.FuncName {
+				continue
+			}
+			n, found := funcocc[fn.Name]
+			if !found {
+				n = 0
+			}
+			funcocc[fn.Name] = n + 1
+		}
+	}
+	cands := make([]string, 0, len(funcocc))
+	for funcname, n := range funcocc {
+		if n == len(pkgfuncs) {
+			cands = append(cands, funcname)
+		}
+	}
+
+	log_Debug(cfg.Verbose, "cands: %+v\n", cands)
+	if len(cands) == 0 {
+		return nil, fmt.Errorf("cannot find any common public function in all packages")
+	}
+	if len(cands) > 1 {
+		return nil, fmt.Errorf("multiple common public functions, specify one with Config.FuncName: %v", cands)
+	}
+
+	fname := cands[0]
+
+	if err := check_signature(fname, pkgfuncs); err != nil {
+		return nil, err
+	}
+
+	var fn ExportedFunction
+	for _, fns := range pkgfuncs {
+		for _, f := range fns {
+			if f.Name == fname {
+				fn = f
+				break
+			}
+		}
+		break
+	}
+
+	log_Debug(cfg.Verbose, "interface function is %s: %+v\n", fname, fn)
+
+	pkgPaths := make([]string, 0, len(pkgfuncs))
+	for pkgPath := range pkgfuncs {
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	sort.Strings(pkgPaths)
+
+	plan := &Plan{cfg: cfg}
+	switch cfg.Mode {
+	case ModeStatic:
+		plan.code = generate_static_code(fn, pkgPaths)
+	case ModeDynamic:
+		plan.code = generate_dynamic_code(fn)
+		plan.makefile = generate_dynamic_makefile(pkgPaths)
+		plan.pluginMains = make(map[string]string, len(pkgPaths))
+		for _, pkgPath := range pkgPaths {
+			code := generate_plugin_main_code(fn, pkgPath)
+			plan.pluginMains[plugin_main_path(pkgPath)] = strings.Join(code, "\n")
+		}
+	default:
+		return nil, fmt.Errorf("unknown mode %q, want %q or %q", cfg.Mode, ModeStatic, ModeDynamic)
+	}
+
+	return plan, nil
+}
+
+// scan_iface implements interface mode: every plugin package must supply
+// all of cfg.Interface's methods, either as free functions or as methods on
+// an exported New() factory's result.
+func scan_iface(cfg Config, root *packages.Package, pluginPkgs []*packages.Package) (*Plan, error) {
+	// Whenever Dir has its own root package, the generated file must join
+	// it: go/packages refuses to load a directory holding files from two
+	// different package clauses, so there's no way to write a standalone
+	// "plugins" package alongside root's files. Only skip declaring
+	// cfg.Interface when it's the root package's own pre-existing
+	// declaration we're binding against (the find_iface_methods path);
+	// when it's synthesized from Methods, it still needs declaring even
+	// if that declaration now lands in root's package.
+	pkgName := "plugins"
+	if root != nil {
+		pkgName = root.Name
+	}
+	declareIface := true
+	var methodNames []string
+	if len(cfg.Methods) > 0 {
+		for _, m := range strings.Split(cfg.Methods, ",") {
+			methodNames = append(methodNames, strings.TrimSpace(m))
+		}
+	} else {
+		names, err := find_iface_methods(root, cfg.Interface)
+		if err != nil {
+			return nil, err
+		}
+		methodNames = names
+		declareIface = false
+	}
+	log_Debug(cfg.Verbose, "binding methods: %+v\n", methodNames)
+
+	bindings := make(map[string]*PackageBinding, len(pluginPkgs))
+	for _, p := range pluginPkgs {
+		binding, err := bind_package_methods(p, methodNames)
+		if err != nil {
+			return nil, err
+		}
+		bindings[p.PkgPath] = binding
+	}
+
+	if err := check_method_signatures(bindings, methodNames); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{cfg: cfg}
+	plan.code = generate_iface_code(pkgName, cfg.Interface, methodNames, bindings, declareIface)
+	return plan, nil
+}
+
+type ExportedFunction struct {
+	Name      string
+	Deps      []string
+	Signature string
+	Sig       *types.Signature
+}
+
+// qualifier controls how package-qualified type names are rendered in
+// signature-mismatch diagnostics. It's never used to render importable
+// code: bare package names collide whenever two dependency packages share
+// a base name (multiple vendored v1/types/api packages, say), so every
+// generator below instead builds its own qualifier off dep_aliases.
+func qualifier(p *types.Package) string { return p.Name() }
+
+// dep_aliases assigns a stable, collision-free import alias (d0, d1, ...)
+// to each dependency package path, in the order they were first
+// referenced by a scanned signature. Kept distinct from the p0, p1, ...
+// aliases generate_static_code/generate_iface_code assign the scanned
+// plugin packages themselves, so a dependency package never collides with
+// a plugin package's alias either.
+func dep_aliases(deps []string) map[string]string {
+	aliases := make(map[string]string, len(deps))
+	for i, dep := range deps {
+		aliases[dep] = fmt.Sprintf("d%d", i)
+	}
+	return aliases
+}
+
+// qualifier_for renders package-qualified type names for generated code:
+// pkgAliases (typically the scanned plugin packages' p0, p1, ... import
+// aliases) take priority, then depAliases (d0, d1, ...), so every package
+// a signature can possibly mention - the plugin package itself or any
+// package its parameter/result types come from - gets the distinct,
+// collision-free alias its import line uses.
+func qualifier_for(pkgAliases, depAliases map[string]string) types.Qualifier {
+	return func(p *types.Package) string {
+		if alias, ok := pkgAliases[p.Path()]; ok {
+			return alias
+		}
+		if alias, ok := depAliases[p.Path()]; ok {
+			return alias
+		}
+		return p.Name()
+	}
+}
+
+// loadMode is what we need packages.Load to hand back: enough to discover
+// every package under base, read its exported API via go/types, and keep
+// the syntax trees around for the interface-mode lookup. Using a single
+// packages.Load call also means every loaded package shares one type
+// checker, so named types like io.Reader compare equal across packages,
+// build tags and //go:build constraints are respected, and load/type
+// errors surface instead of being swallowed the way a raw ioutil.ReadFile
+// failure used to be.
+const loadMode = packages.NeedName | packages.NeedFiles | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax
+
+// load_packages loads every package under base and returns the one whose
+// files live directly in base (the "root" package, if any, where an
+// interface may be declared) separately from the rest (the plugin
+// packages), optionally filtered to those whose import path is or is under
+// pkgFilter.
+func load_packages(base, pkgFilter string) (root *packages.Package, plugins []*packages.Package, err error) {
+	cfg := &packages.Config{Mode: loadMode, Dir: base}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading packages under %s: %w", base, err)
+	}
+
+	var loadErrs []error
+	for _, p := range pkgs {
+		for _, e := range p.Errors {
+			loadErrs = append(loadErrs, fmt.Errorf("%s: %w", p.PkgPath, e))
+		}
+	}
+	if len(loadErrs) > 0 {
+		return nil, nil, fmt.Errorf("%d error(s) loading %s: %v", len(loadErrs), base, loadErrs)
+	}
+
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, p := range pkgs {
+		if len(p.GoFiles) > 0 && filepath.Dir(p.GoFiles[0]) == absBase {
+			root = p
+			continue
+		}
+		if len(pkgFilter) > 0 && p.PkgPath != pkgFilter && !strings.HasPrefix(p.PkgPath, pkgFilter+"/") {
+			continue
+		}
+		plugins = append(plugins, p)
+	}
+
+	return root, plugins, nil
+}
+
+// package_functions returns every exported, top-level function declared in
+// p, with its signature and dependencies resolved via p's own go/types
+// data rather than by slicing source text.
+func package_functions(p *packages.Package, verbose bool) []ExportedFunction {
+	funcs := make([]ExportedFunction, 0)
+
+	for _, file := range p.Syntax {
+		for _, d := range file.Decls {
+			f, ok := d.(*ast.FuncDecl)
+			if !ok || !f.Name.IsExported() || f.Recv != nil {
+				continue
+			}
+
+			obj := p.Types.Scope().Lookup(f.Name.Name)
+			fnobj, ok := obj.(*types.Func)
+			if !ok {
+				log_Debug(verbose, "no type information for %s, skipping\n", f.Name.Name)
+				continue
+			}
+			sig, ok := fnobj.Type().(*types.Signature)
+			if !ok {
+				continue
+			}
+
+			funcs = append(funcs, build_exported_function(f.Name.Name, sig, verbose))
+		}
+	}
+
+	return funcs
+}
+
+// build_exported_function renders sig's dependencies and signature text for
+// name, the way both free-function (static mode) and method (interface
+// mode) bindings need it.
+func build_exported_function(name string, sig *types.Signature, verbose bool) ExportedFunction {
+	seen := make(map[string]bool)
+	deps := make([]string, 0)
+	for i := 0; i < sig.Params().Len(); i++ {
+		collect_deps(sig.Params().At(i).Type(), seen, &deps)
+	}
+	for i := 0; i < sig.Results().Len(); i++ {
+		collect_deps(sig.Results().At(i).Type(), seen, &deps)
+	}
+	for _, dep := range deps {
+		log_Debug(verbose, "appending dep: %s\n", dep)
+	}
+
+	return ExportedFunction{
+		Name:      name,
+		Deps:      deps,
+		Signature: strings.TrimPrefix(types.TypeString(sig, qualifier), "func"),
+		Sig:       sig,
+	}
+}
+
+// check_signature verifies that every package's version of the candidate
+// function has an identical signature, using types.Identical so that named
+// types are only considered compatible when they come from the exact same
+// package (not merely packages with the same name). It returns a precise
+// diagnostic naming the two disagreeing packages and their signatures, in
+// the style of cmd/api's exported-API diffs, instead of the generator
+// silently picking one package's signature and emitting code that may not
+// compile against the others.
+func check_signature(name string, pkgfuncs map[string][]ExportedFunction) error {
+	var basePkg string
+	var base *ExportedFunction
+
+	for pkg, fns := range pkgfuncs {
+		for i := range fns {
+			fn := &fns[i]
+			if fn.Name != name {
+				continue
+			}
+			if base == nil {
+				basePkg, base = pkg, fn
+				continue
+			}
+			if !types.Identical(base.Sig, fn.Sig) {
+				return fmt.Errorf(
+					"func %s has incompatible signatures across packages:\n\tpkg %s: func%s\n\tpkg %s: func%s",
+					name, basePkg, base.Signature, pkg, fn.Signature)
+			}
+		}
+	}
+
+	return nil
+}
+
+// collect_deps walks t looking for named types and records the import path
+// of the package that declares each one, so the generated code can import
+// exactly what the signature needs.
+func collect_deps(t types.Type, seen map[string]bool, deps *[]string) {
+	switch t := t.(type) {
+	case *types.Named:
+		if obj := t.Obj(); obj != nil && obj.Pkg() != nil {
+			path := obj.Pkg().Path()
+			if !seen[path] {
+				seen[path] = true
+				*deps = append(*deps, path)
+			}
+		}
+		if targs := t.TypeArgs(); targs != nil {
+			for i := 0; i < targs.Len(); i++ {
+				collect_deps(targs.At(i), seen, deps)
+			}
+		}
+	case *types.Pointer:
+		collect_deps(t.Elem(), seen, deps)
+	case *types.Slice:
+		collect_deps(t.Elem(), seen, deps)
+	case *types.Array:
+		collect_deps(t.Elem(), seen, deps)
+	case *types.Map:
+		collect_deps(t.Key(), seen, deps)
+		collect_deps(t.Elem(), seen, deps)
+	case *types.Chan:
+		collect_deps(t.Elem(), seen, deps)
+	case *types.Signature:
+		for i := 0; i < t.Params().Len(); i++ {
+			collect_deps(t.Params().At(i).Type(), seen, deps)
+		}
+		for i := 0; i < t.Results().Len(); i++ {
+			collect_deps(t.Results().At(i).Type(), seen, deps)
+		}
+	case *types.Struct:
+		for i := 0; i < t.NumFields(); i++ {
+			collect_deps(t.Field(i).Type(), seen, deps)
+		}
+	case *types.Interface:
+		for i := 0; i < t.NumEmbeddeds(); i++ {
+			collect_deps(t.EmbeddedType(i), seen, deps)
+		}
+		for i := 0; i < t.NumExplicitMethods(); i++ {
+			collect_deps(t.ExplicitMethod(i).Type(), seen, deps)
+		}
+	}
+}
+
+// PackageBinding is one package's answer to interface mode: either it
+// exposes every required method as a free exported function (Factory ==
+// ""), or it exposes an exported type whose methods satisfy them,
+// constructed via an exported factory function (conventionally New()).
+type PackageBinding struct {
+	Factory    string
+	FactorySig *types.Signature
+	Methods    map[string]ExportedFunction
+}
+
+// find_iface_methods looks for `type <name> interface { ... }` among
+// root's files and returns its method names, in the order they're
+// declared. root is the package living directly in the base directory, as
+// returned by load_packages; it is nil if base has no Go files of its own.
+func find_iface_methods(root *packages.Package, name string) ([]string, error) {
+	if root == nil {
+		return nil, fmt.Errorf("no Go package directly in the base directory to look up interface %s in; set Config.Methods instead", name)
+	}
+
+	for _, file := range root.Syntax {
+		for _, d := range file.Decls {
+			gd, ok := d.(*ast.GenDecl)
+			if !ok || gd.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok || ts.Name.Name != name {
+					continue
+				}
+				it, ok := ts.Type.(*ast.InterfaceType)
+				if !ok {
+					return nil, fmt.Errorf("%s is not an interface type", name)
+				}
+				methods := make([]string, 0, len(it.Methods.List))
+				for _, m := range it.Methods.List {
+					if len(m.Names) == 0 {
+						return nil, fmt.Errorf("embedded interfaces are not supported in %s", name)
+					}
+					methods = append(methods, m.Names[0].Name)
+				}
+				return methods, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("interface %s not declared in %s, and no Config.Methods given to synthesize it", name, root.PkgPath)
+}
+
+// bind_package_methods resolves methodNames against p to either free
+// exported functions or methods reachable off an exported New() factory,
+// the way mockgen's source mode resolves an interface against a concrete
+// package.
+func bind_package_methods(p *packages.Package, methodNames []string) (*PackageBinding, error) {
+	scope := p.Types.Scope()
+
+	free := make(map[string]ExportedFunction, len(methodNames))
+	allFree := true
+	for _, name := range methodNames {
+		fn, ok := scope.Lookup(name).(*types.Func)
+		if !ok {
+			allFree = false
+			break
+		}
+		free[name] = build_exported_function(name, fn.Type().(*types.Signature), false)
+	}
+	if allFree {
+		return &PackageBinding{Methods: free}, nil
+	}
+
+	factory, ok := scope.Lookup("New").(*types.Func)
+	if !ok {
+		return nil, fmt.Errorf("package %s has neither free functions for all of %v nor an exported New() factory", p.PkgPath, methodNames)
+	}
+	factorySig := factory.Type().(*types.Signature)
+	if factorySig.Params().Len() != 0 || factorySig.Results().Len() != 1 {
+		return nil, fmt.Errorf("package %s: New() must take no arguments and return exactly one value", p.PkgPath)
+	}
+
+	recv := factorySig.Results().At(0).Type()
+	mset := types.NewMethodSet(recv)
+	methods := make(map[string]ExportedFunction, len(methodNames))
+	for _, name := range methodNames {
+		sel := mset.Lookup(p.Types, name)
+		if sel == nil {
+			return nil, fmt.Errorf("package %s: %s has no method %s", p.PkgPath, recv, name)
+		}
+		methods[name] = build_exported_function(name, sel.Obj().(*types.Func).Type().(*types.Signature), false)
+	}
+
+	return &PackageBinding{Factory: "New", FactorySig: factorySig, Methods: methods}, nil
+}
+
+// check_method_signatures applies the same cross-package compatibility
+// check as check_signature, once per method, so a mismatched method fails
+// fast with a diff instead of producing an interface that only some
+// packages actually satisfy.
+func check_method_signatures(bindings map[string]*PackageBinding, methodNames []string) error {
+	for _, name := range methodNames {
+		var basePkg string
+		var base ExportedFunction
+		haveBase := false
+
+		for pkg, b := range bindings {
+			fn, ok := b.Methods[name]
+			if !ok {
+				continue
+			}
+			if !haveBase {
+				basePkg, base, haveBase = pkg, fn, true
+				continue
+			}
+			if !types.Identical(base.Sig, fn.Sig) {
+				return fmt.Errorf(
+					"method %s has incompatible signatures across packages:\n\tpkg %s: func%s\n\tpkg %s: func%s",
+					name, basePkg, base.Signature, pkg, fn.Signature)
+			}
+		}
+	}
+	return nil
+}
+
+// render_params_results renders sig's parameters (named a0, a1, ... so the
+// adapter methods below always have valid, collision-free identifiers) and
+// result list, using qual to print package-qualified type names.
+func render_params_results(sig *types.Signature, qual types.Qualifier) (params []string, args []string, results string) {
+	n := sig.Params().Len()
+	for i := 0; i < n; i++ {
+		pname := fmt.Sprintf("a%d", i)
+		typ := types.TypeString(sig.Params().At(i).Type(), qual)
+		if sig.Variadic() && i == n-1 {
+			params = append(params, pname+" ..."+strings.TrimPrefix(typ, "[]"))
+			args = append(args, pname+"...")
+		} else {
+			params = append(params, pname+" "+typ)
+			args = append(args, pname)
+		}
+	}
+
+	rs := make([]string, 0, sig.Results().Len())
+	for i := 0; i < sig.Results().Len(); i++ {
+		rs = append(rs, types.TypeString(sig.Results().At(i).Type(), qual))
+	}
+	switch len(rs) {
+	case 0:
+	case 1:
+		results = " " + rs[0]
+	default:
+		results = " (" + strings.Join(rs, ", ") + ")"
+	}
+	return
+}
+
+// generate_iface_code renders one adapter struct per package binding its
+// methods (forwarding to the package's free functions, or to its New()
+// factory's result) and the Plugins() registry. When declareIface is true
+// it also emits `type <ifaceName> interface{}`; when the interface was
+// found already declared in the root package (rather than synthesized via
+// Config.Methods), declareIface must be false, since the generated file and
+// the root package's interface declaration share a package and a second
+// declaration would redeclare the type. pkgPaths are the full import paths
+// bindings is keyed by.
+func generate_iface_code(pkgName, ifaceName string, methodNames []string, bindings map[string]*PackageBinding, declareIface bool) []string {
+	pkgPaths := make([]string, 0, len(bindings))
+	for pkgPath := range bindings {
+		pkgPaths = append(pkgPaths, pkgPath)
+	}
+	sort.Strings(pkgPaths)
+
+	pkg2importname := make(map[string]string, len(pkgPaths))
+	for i, pkgPath := range pkgPaths {
+		pkg2importname[pkgPath] = fmt.Sprintf("p%d", i)
+	}
+
+	deps := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, pkgPath := range pkgPaths {
+		for _, name := range methodNames {
+			if fn, ok := bindings[pkgPath].Methods[name]; ok {
+				for _, dep := range fn.Deps {
+					if !seen[dep] {
+						seen[dep] = true
+						deps = append(deps, dep)
+					}
+				}
+			}
+		}
+	}
+	depAliases := dep_aliases(deps)
+	qual := qualifier_for(pkg2importname, depAliases)
+
+	code := make([]string, 0, len(pkgPaths)*4+16)
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	code = append(code, fmt.Sprintf("// Generated by spluggy on %s", timestamp))
+	code = append(code, fmt.Sprintf("package %s", pkgName))
+	for _, dep := range deps {
+		code = append(code, fmt.Sprintf("import %s \"%s\"", depAliases[dep], dep))
+	}
+	for _, pkgPath := range pkgPaths {
+		code = append(code, fmt.Sprintf("import %s \"%s\"", pkg2importname[pkgPath], pkgPath))
+	}
+
+	if declareIface {
+		code = append(code, fmt.Sprintf("\ntype %s interface {", ifaceName))
+		for _, name := range methodNames {
+			// Any package's binding has an identical signature at this point.
+			sig := bindings[pkgPaths[0]].Methods[name].Sig
+			params, _, results := render_params_results(sig, qual)
+			code = append(code, fmt.Sprintf("\t%s(%s)%s", name, strings.Join(params, ", "), results))
+		}
+		code = append(code, "}\n")
+	}
+
+	for _, pkgPath := range pkgPaths {
+		importname := pkg2importname[pkgPath]
+		typeName := importname + "Plugin"
+		b := bindings[pkgPath]
+
+		if b.Factory == "" {
+			code = append(code, fmt.Sprintf("type %s struct{}\n", typeName))
+		} else {
+			implType := types.TypeString(b.FactorySig.Results().At(0).Type(), qual)
+			code = append(code, fmt.Sprintf("type %s struct{ impl %s }\n", typeName, implType))
+		}
+
+		for _, name := range methodNames {
+			sig := b.Methods[name].Sig
+			params, args, results := render_params_results(sig, qual)
+			call := fmt.Sprintf("%s.%s", importname, name)
+			recv := "_"
+			if b.Factory != "" {
+				recv = "x"
+				call = fmt.Sprintf("x.impl.%s", name)
+			}
+			code = append(code, fmt.Sprintf("func (%s %s) %s(%s)%s { return %s(%s) }",
+				recv, typeName, name, strings.Join(params, ", "), results, call, strings.Join(args, ", ")))
+		}
+		code = append(code, "")
+	}
+
+	code = append(code, fmt.Sprintf("func Plugins() map[string]%s {\n", ifaceName))
+	code = append(code, fmt.Sprintf("\tplugins := make(map[string]%s)\n", ifaceName))
+	for _, pkgPath := range pkgPaths {
+		importname := pkg2importname[pkgPath]
+		typeName := importname + "Plugin"
+		key := path.Base(pkgPath)
+		if bindings[pkgPath].Factory == "" {
+			code = append(code, fmt.Sprintf("\tplugins[\"%s\"] = %s{}", key, typeName))
+		} else {
+			code = append(code, fmt.Sprintf("\tplugins[\"%s\"] = %s{impl: %s.%s()}", key, typeName, importname, bindings[pkgPath].Factory))
+		}
+	}
+	code = append(code, "\n\treturn plugins\n}\n")
+
+	return code
+}
+
+// generate_static_code renders the default mode: every scanned package is
+// imported directly and Plugins() returns a map built from those imports.
+// pkgPaths are the full import paths discovered by load_packages.
+func generate_static_code(fn ExportedFunction, pkgPaths []string) []string {
+	code := make([]string, 0, len(pkgPaths)+16)
+
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	code = append(code, fmt.Sprintf("// Generated by spluggy on %s", timestamp))
+	code = append(code, "package plugins")
+
+	depAliases := dep_aliases(fn.Deps)
+	for _, dep := range fn.Deps {
+		code = append(code, fmt.Sprintf("import %s \"%s\"", depAliases[dep], dep))
+	}
+
+	pkg2importname := make(map[string]string, len(pkgPaths))
+	for i, pkgPath := range pkgPaths {
+		importname := fmt.Sprintf("p%d", i)
+		pkg2importname[pkgPath] = importname
+		code = append(code, fmt.Sprintf("import %s \"%s\"", importname, pkgPath))
+	}
+
+	qual := qualifier_for(pkg2importname, depAliases)
+	signature := strings.TrimPrefix(types.TypeString(fn.Sig, qual), "func")
+	code = append(code, fmt.Sprintf("\ntype Function func%s\n", signature))
+
+	code = append(code, "func Plugins() map[string]Function {\n")
+	code = append(code, "\tplugins := make(map[string]Function)\n")
+
+	for _, pkgPath := range pkgPaths {
+		code = append(code, fmt.Sprintf("\tplugins[\"%s\"] = %s.%s", path.Base(pkgPath), pkg2importname[pkgPath], fn.Name))
+	}
+
+	code = append(code, "\n\treturn plugins\n}\n")
+
+	return code
+}
+
+// generate_dynamic_code renders -mode=dynamic: instead of importing every
+// scanned package, Plugins(dir) discovers *.so files at runtime and
+// resolves fn.Name in each via the plugin package, asserting it to the
+// same Function type the static mode declares. Each .so is built from a
+// generated wrapper main package (see generate_plugin_main_code), not the
+// plugin package directly, since only main packages can be built with
+// -buildmode=plugin. This lets a host add or replace plugins without being
+// recompiled, at the cost of giving up the compile-time import check the
+// static mode gets for free.
+func generate_dynamic_code(fn ExportedFunction) []string {
+	code := make([]string, 0, 24)
+
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	code = append(code, fmt.Sprintf("// Generated by spluggy on %s", timestamp))
+	code = append(code, "package plugins")
+	code = append(code, "import \"fmt\"")
+	code = append(code, "import \"path/filepath\"")
+	code = append(code, "import \"plugin\"")
+	code = append(code, "import \"strings\"")
+	depAliases := dep_aliases(fn.Deps)
+	for _, dep := range fn.Deps {
+		code = append(code, fmt.Sprintf("import %s \"%s\"", depAliases[dep], dep))
+	}
+
+	// Function must be a type alias (=), not a defined type: plugin.Open
+	// loads the wrapper main package (see generate_plugin_main_code) as a
+	// separate package instance from this one, so p.Lookup's symbol has
+	// whatever type Go assigned the wrapped function, an unnamed
+	// func literal. A defined "type Function func%[1]s" would never
+	// type-assert equal to that; an alias makes Function exactly that
+	// same unnamed function type, which does.
+	qual := qualifier_for(nil, depAliases)
+	signature := strings.TrimPrefix(types.TypeString(fn.Sig, qual), "func")
+	code = append(code, fmt.Sprintf("\ntype Function = func%s\n", signature))
+
+	code = append(code, "// Plugins discovers every *.so file in dir, built with -buildmode=plugin")
+	code = append(code, fmt.Sprintf("// (see Makefile.plugins), and resolves each one's %s symbol to a", fn.Name))
+	code = append(code, "// Function, keyed by the plugin's file name with the .so suffix removed.")
+	code = append(code, "func Plugins(dir string) (map[string]Function, error) {")
+	code = append(code, "\tfiles, err := filepath.Glob(filepath.Join(dir, \"*.so\"))")
+	code = append(code, "\tif err != nil {")
+	code = append(code, "\t\treturn nil, err")
+	code = append(code, "\t}")
+	code = append(code, "")
+	code = append(code, "\tplugins := make(map[string]Function, len(files))")
+	code = append(code, "\tfor _, file := range files {")
+	code = append(code, "\t\tp, err := plugin.Open(file)")
+	code = append(code, "\t\tif err != nil {")
+	code = append(code, "\t\t\treturn nil, fmt.Errorf(\"opening %s: %w\", file, err)")
+	code = append(code, "\t\t}")
+	code = append(code, "")
+	code = append(code, fmt.Sprintf("\t\tsym, err := p.Lookup(%q)", fn.Name))
+	code = append(code, "\t\tif err != nil {")
+	code = append(code, fmt.Sprintf("\t\t\treturn nil, fmt.Errorf(\"looking up %s in %%s: %%w\", file, err)", fn.Name))
+	code = append(code, "\t\t}")
+	code = append(code, "")
+	code = append(code, "\t\tfn, ok := sym.(Function)")
+	code = append(code, "\t\tif !ok {")
+	code = append(code, fmt.Sprintf("\t\t\treturn nil, fmt.Errorf(\"%%s: %s has unexpected type %%T\", file, sym)", fn.Name))
+	code = append(code, "\t\t}")
+	code = append(code, "")
+	code = append(code, "\t\tname := strings.TrimSuffix(filepath.Base(file), \".so\")")
+	code = append(code, "\t\tplugins[name] = fn")
+	code = append(code, "\t}")
+	code = append(code, "\treturn plugins, nil")
+	code = append(code, "}\n")
+
+	return code
+}
+
+// plugin_main_dir is where the wrapper main package for pkgPath (see
+// generate_plugin_main_code) lives, relative to Config.Dir. It's named
+// after pkgPath, like the .so it builds, and put under a "_"-prefixed
+// directory so go/packages' "./..." pattern (used by load_packages) never
+// treats the wrapper as a plugin package in its own right.
+func plugin_main_dir(pkgPath string) string {
+	return path.Join("_spluggy_plugins", strings.ReplaceAll(pkgPath, "/", "_"))
+}
+
+// plugin_main_path is the wrapper main package's source file path for
+// pkgPath, relative to Config.Dir.
+func plugin_main_path(pkgPath string) string {
+	return path.Join(plugin_main_dir(pkgPath), "main.go")
+}
+
+// generate_dynamic_makefile emits the companion build rules -mode=dynamic
+// needs: one -buildmode=plugin target per scanned package, named after its
+// full import path so plugins built from differently-named packages never
+// collide on the .so filename. Each target builds that package's wrapper
+// main (see generate_plugin_main_code), not the plugin package itself,
+// since only main packages can be built with -buildmode=plugin.
+func generate_dynamic_makefile(pkgPaths []string) []string {
+	lines := make([]string, 0, len(pkgPaths)*3+4)
+	lines = append(lines, "# Generated by spluggy -mode=dynamic.")
+	lines = append(lines, "# Run `make -f Makefile.plugins` to build every plugin as a .so before")
+	lines = append(lines, "# starting a host that calls plugins.Plugins().")
+	lines = append(lines, "")
+
+	targets := make([]string, 0, len(pkgPaths))
+	for _, pkgPath := range pkgPaths {
+		soName := strings.ReplaceAll(pkgPath, "/", "_") + ".so"
+		targets = append(targets, soName)
+		lines = append(lines, fmt.Sprintf("%s:", soName))
+		lines = append(lines, fmt.Sprintf("\tgo build -buildmode=plugin -o $@ ./%s", plugin_main_dir(pkgPath)))
+		lines = append(lines, "")
+	}
+
+	lines = append(lines, fmt.Sprintf("plugins: %s", strings.Join(targets, " ")))
+	lines = append(lines, "")
+	lines = append(lines, ".PHONY: plugins")
+	lines = append(lines, "")
+
+	return lines
+}
+
+// generate_plugin_main_code renders pkgPath's wrapper main package: it
+// imports pkgPath and re-exports fn under the same name, so the .so
+// Makefile.plugins builds from it still exports the symbol
+// generate_dynamic_code's loader looks up with p.Lookup(fn.Name). This
+// indirection exists because Go's plugin package will only build a main
+// package into a .so ("-buildmode=plugin requires exactly one main
+// package"), while the plugin packages spluggy scans are ordinary
+// importable packages, shared with ModeStatic's direct imports.
+func generate_plugin_main_code(fn ExportedFunction, pkgPath string) []string {
+	depAliases := dep_aliases(fn.Deps)
+	qual := func(p *types.Package) string {
+		if p.Path() == pkgPath {
+			return "plugin"
+		}
+		if alias, ok := depAliases[p.Path()]; ok {
+			return alias
+		}
+		return p.Name()
+	}
+	params, args, results := render_params_results(fn.Sig, qual)
+
+	code := make([]string, 0, 8+len(fn.Deps))
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	code = append(code, fmt.Sprintf("// Generated by spluggy on %s", timestamp))
+	code = append(code, "package main")
+	for _, dep := range fn.Deps {
+		code = append(code, fmt.Sprintf("import %s \"%s\"", depAliases[dep], dep))
+	}
+	code = append(code, fmt.Sprintf("import plugin \"%s\"", pkgPath))
+	code = append(code, fmt.Sprintf("\nfunc %s(%s)%s { return plugin.%s(%s) }\n",
+		fn.Name, strings.Join(params, ", "), results, fn.Name, strings.Join(args, ", ")))
+
+	return code
+}
+
+func log_Debug(verbose bool, fmtstr string, vars ...interface{}) {
+	if !verbose {
+		return
+	}
+	log.Printf("[DEBUG] "+fmtstr, vars...)
+}
@@ -0,0 +1,251 @@
+package spluggy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// write_fixture materializes files (path -> content, relative to dir) under
+// a fresh temp directory and returns it.
+func write_fixture(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for rel, content := range files {
+		full := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("MkdirAll %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile %s: %v", full, err)
+		}
+	}
+	return dir
+}
+
+func TestScanStaticMode(t *testing.T) {
+	dir := write_fixture(t, map[string]string{
+		"go.mod": "module fixture\n\ngo 1.21\n",
+		"a/a.go": "package a\n\nfunc Run(name string) string { return \"a:\" + name }\n",
+		"b/b.go": "package b\n\nfunc Run(name string) string { return \"b:\" + name }\n",
+	})
+
+	plan, err := Scan(Config{Dir: dir, FuncName: "Run"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := plan.Render(&sb); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	out := sb.String()
+
+	for _, want := range []string{
+		"package plugins",
+		"type Function func(name string) string",
+		`plugins["a"] = p0.Run`,
+		`plugins["b"] = p1.Run`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code missing %q, got:\n%s", want, out)
+		}
+	}
+
+	if _, ok := plan.Makefile(); ok {
+		t.Errorf("Makefile() ok = true for static mode, want false")
+	}
+	if plan.PluginMains() != nil {
+		t.Errorf("PluginMains() = %v for static mode, want nil", plan.PluginMains())
+	}
+}
+
+func TestScanStaticModeSignatureMismatch(t *testing.T) {
+	dir := write_fixture(t, map[string]string{
+		"go.mod": "module fixture\n\ngo 1.21\n",
+		"a/a.go": "package a\n\nfunc Run(name string) string { return name }\n",
+		"b/b.go": "package b\n\nfunc Run(name int) string { return \"\" }\n",
+	})
+
+	_, err := Scan(Config{Dir: dir, FuncName: "Run"})
+	if err == nil {
+		t.Fatal("Scan succeeded, want an incompatible-signatures error")
+	}
+	if !strings.Contains(err.Error(), "incompatible signatures") {
+		t.Errorf("Scan error = %q, want it to mention incompatible signatures", err)
+	}
+}
+
+func TestScanIfaceModeRootDeclared(t *testing.T) {
+	dir := write_fixture(t, map[string]string{
+		"go.mod":   "module fixture\n\ngo 1.21\n",
+		"iface.go": "package base\n\ntype Plugin interface {\n\tInit() error\n\tHandle(name string) (string, error)\n}\n",
+		"a/a.go":   "package a\n\nfunc Init() error { return nil }\nfunc Handle(name string) (string, error) { return \"a:\" + name, nil }\n",
+		"b/b.go":   "package b\n\nfunc Init() error { return nil }\nfunc Handle(name string) (string, error) { return \"b:\" + name, nil }\n",
+	})
+
+	plan, err := Scan(Config{Dir: dir, Interface: "Plugin"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := plan.Render(&sb); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	out := sb.String()
+
+	if strings.Contains(out, "type Plugin interface") {
+		t.Errorf("generated code redeclares Plugin, which root already declares:\n%s", out)
+	}
+	if !strings.Contains(out, "package base") {
+		t.Errorf("generated code should join root's package base, got:\n%s", out)
+	}
+	for _, want := range []string{
+		`plugins["a"] = p0Plugin{}`,
+		`plugins["b"] = p1Plugin{}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("generated code missing %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestScanIfaceModeMethodsSynthesized(t *testing.T) {
+	dir := write_fixture(t, map[string]string{
+		"go.mod": "module fixture\n\ngo 1.21\n",
+		"a/a.go": "package a\n\nfunc Init() error { return nil }\nfunc Handle(name string) (string, error) { return \"a:\" + name, nil }\n",
+		"b/b.go": "package b\n\nfunc Init() error { return nil }\nfunc Handle(name string) (string, error) { return \"b:\" + name, nil }\n",
+	})
+
+	plan, err := Scan(Config{Dir: dir, Interface: "Plugin", Methods: "Init,Handle"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := plan.Render(&sb); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	out := sb.String()
+
+	if !strings.Contains(out, "package plugins") {
+		t.Errorf("generated code should use the standalone plugins package when Dir has no root package, got:\n%s", out)
+	}
+	if !strings.Contains(out, "type Plugin interface {") {
+		t.Errorf("generated code should declare the synthesized Plugin interface, got:\n%s", out)
+	}
+}
+
+func TestScanIfaceModeMethodsSynthesizedWithRootPackage(t *testing.T) {
+	dir := write_fixture(t, map[string]string{
+		"go.mod":  "module fixture\n\ngo 1.21\n",
+		"root.go": "package mypkg\n\nfunc Helper() {}\n",
+		"a/a.go":  "package a\n\nfunc Init() error { return nil }\nfunc Handle(name string) (string, error) { return \"a:\" + name, nil }\n",
+		"b/b.go":  "package b\n\nfunc Init() error { return nil }\nfunc Handle(name string) (string, error) { return \"b:\" + name, nil }\n",
+	})
+
+	plan, err := Scan(Config{Dir: dir, Interface: "Plugin", Methods: "Init,Handle"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := plan.Render(&sb); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	out := sb.String()
+
+	// Regression test: Scan must join mypkg, the existing root package,
+	// rather than writing a second "package plugins" file into the same
+	// directory, which go/packages refuses to load.
+	if !strings.Contains(out, "package mypkg") {
+		t.Errorf("generated code should join root's package mypkg, got:\n%s", out)
+	}
+	if !strings.Contains(out, "type Plugin interface {") {
+		t.Errorf("generated code should still declare the synthesized Plugin interface, got:\n%s", out)
+	}
+}
+
+func TestScanStaticModeWithDependencyTypes(t *testing.T) {
+	// Run references two dependency packages that happen to share a base
+	// name (depv1): regression test for a qualifier that aliased plugin
+	// packages (p0, p1, ...) but left dependency packages unaliased, so
+	// two same-named dep packages produced two `import "path"` lines for
+	// the same identifier.
+	dir := write_fixture(t, map[string]string{
+		"go.mod":                    "module fixture\n\ngo 1.21\n",
+		"dep/depv1/depv1.go":        "package depv1\n\ntype Request struct{ Name string }\n",
+		"dep/nested/depv1/depv1.go": "package depv1\n\ntype Request struct{ Name string }\n",
+		"plugins/a/a.go":            "package a\n\nimport (\n\t\"fixture/dep/depv1\"\n\tnested \"fixture/dep/nested/depv1\"\n)\n\nfunc Run(req depv1.Request, other nested.Request) string { return \"a:\" + req.Name + other.Name }\n",
+		"plugins/b/b.go":            "package b\n\nimport (\n\t\"fixture/dep/depv1\"\n\tnested \"fixture/dep/nested/depv1\"\n)\n\nfunc Run(req depv1.Request, other nested.Request) string { return \"b:\" + req.Name + other.Name }\n",
+	})
+
+	plan, err := Scan(Config{Dir: dir, FuncName: "Run", BasePkg: "fixture/plugins"})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := plan.Render(&sb); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	out := sb.String()
+
+	if !strings.Contains(out, `import d0 "fixture/dep/depv1"`) || !strings.Contains(out, `import d1 "fixture/dep/nested/depv1"`) {
+		t.Errorf("generated code missing aliased dependency imports, got:\n%s", out)
+	}
+	if strings.Contains(out, `import "fixture/dep/depv1"`) || strings.Contains(out, `import "fixture/dep/nested/depv1"`) {
+		t.Errorf("generated code should not import dependency packages unaliased, got:\n%s", out)
+	}
+	if !strings.Contains(out, "type Function func(req d0.Request, other d1.Request) string") {
+		t.Errorf("generated code missing aliased Function type, got:\n%s", out)
+	}
+}
+
+func TestScanDynamicMode(t *testing.T) {
+	dir := write_fixture(t, map[string]string{
+		"go.mod": "module fixture\n\ngo 1.21\n",
+		"a/a.go": "package a\n\nfunc Run(name string) string { return \"a:\" + name }\n",
+		"b/b.go": "package b\n\nfunc Run(name string) string { return \"b:\" + name }\n",
+	})
+
+	plan, err := Scan(Config{Dir: dir, FuncName: "Run", Mode: ModeDynamic})
+	if err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+
+	var sb strings.Builder
+	if err := plan.Render(&sb); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	out := sb.String()
+	if !strings.Contains(out, "type Function = func(name string) string") {
+		t.Errorf("generated code should declare Function as a type alias, got:\n%s", out)
+	}
+
+	makefile, ok := plan.Makefile()
+	if !ok {
+		t.Fatal("Makefile() ok = false for dynamic mode, want true")
+	}
+	if !strings.Contains(string(makefile), "-buildmode=plugin") {
+		t.Errorf("Makefile missing -buildmode=plugin, got:\n%s", makefile)
+	}
+
+	mains := plan.PluginMains()
+	if len(mains) != 2 {
+		t.Fatalf("PluginMains() = %d entries, want 2: %v", len(mains), mains)
+	}
+	for rel, content := range mains {
+		if !strings.HasPrefix(rel, "_spluggy_plugins/") {
+			t.Errorf("plugin main path %q should live under _spluggy_plugins/", rel)
+		}
+		if !strings.Contains(content, "package main") {
+			t.Errorf("plugin main %q should be package main, got:\n%s", rel, content)
+		}
+		if !strings.Contains(content, "func Run(") {
+			t.Errorf("plugin main %q should re-export Run, got:\n%s", rel, content)
+		}
+	}
+}